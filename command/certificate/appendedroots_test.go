@@ -0,0 +1,158 @@
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+)
+
+// issueLeaf creates a self-signed root and a leaf it signs, returning both
+// along with the PEM-encoded root, so tests can write it to disk as
+// --roots/--roots-append input.
+func issueLeaf(t *testing.T, cn string) (leaf *x509.Certificate, rootPEM []byte) {
+	t.Helper()
+
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn + "-root"},
+		NotBefore:             time.Unix(0, 0),
+		NotAfter:              time.Unix(0, 0).Add(100 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Unix(0, 0).Add(100 * 365 * 24 * time.Hour),
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, root, &leafKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err = x509.ParseCertificate(leafDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return leaf, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootDER})
+}
+
+func writeRootFile(t *testing.T, pemBytes []byte) string {
+	t.Helper()
+	f, err := ioutil.TempFile("", "appendedroots-*.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(f.Name()) })
+	if _, err := f.Write(pemBytes); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	return f.Name()
+}
+
+func TestVerifyWithAppendedRoots(t *testing.T) {
+	leaf, rootPEM := issueLeaf(t, "leaf")
+	rootFile := writeRootFile(t, rootPEM)
+
+	t.Run("chains via the merged pool when --roots is not given", func(t *testing.T) {
+		opts := x509.VerifyOptions{}
+		chains, err := verifyWithAppendedRoots(leaf, opts, rootFile, "merge")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(chains) == 0 {
+			t.Fatal("expected at least one chain")
+		}
+	})
+
+	t.Run("folds a custom --roots pool into the merged pool instead of discarding it", func(t *testing.T) {
+		otherLeaf, otherRootPEM := issueLeaf(t, "other")
+
+		customPool := x509.NewCertPool()
+		if !customPool.AppendCertsFromPEM(otherRootPEM) {
+			t.Fatal("failed to load custom root")
+		}
+		opts := x509.VerifyOptions{Roots: customPool}
+
+		// otherLeaf's root is only in opts.Roots (the --roots pool), not in
+		// the operating system trust store or rootsAppend, so it can only
+		// verify if verifyWithAppendedRoots keeps opts.Roots around.
+		chains, err := verifyWithAppendedRoots(otherLeaf, opts, rootFile, "merge")
+		if err != nil {
+			t.Fatalf("expected --roots pool to still be trusted, got: %v", err)
+		}
+		if len(chains) == 0 {
+			t.Fatal("expected at least one chain")
+		}
+
+		// The pool passed in must not be mutated by folding in rootsAppend.
+		if customPool.Subjects() == nil || len(customPool.Subjects()) != 1 {
+			t.Errorf("expected opts.Roots to be left with exactly its original root, got %d", len(customPool.Subjects()))
+		}
+	})
+
+	t.Run("fails when neither pool trusts the chain", func(t *testing.T) {
+		untrustedLeaf, _ := issueLeaf(t, "untrusted")
+		opts := x509.VerifyOptions{}
+		if _, err := verifyWithAppendedRoots(untrustedLeaf, opts, rootFile, "merge"); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestVerifyWithAppendedRoots_SystemRootsOff(t *testing.T) {
+	rootFile := writeRootFile(t, issueLeafRootPEM(t))
+
+	envLeaf, envRootPEM := issueLeaf(t, "env-only")
+	t.Setenv("SSL_CERT_FILE", writeRootFile(t, envRootPEM))
+
+	// --system-roots=off must merge against the plain OS trust store, not
+	// x509util.SystemCertPool's OS-plus-SSL_CERT_FILE pool: a certificate
+	// trusted only via SSL_CERT_FILE must not leak back in through
+	// --roots-append.
+	opts := x509.VerifyOptions{}
+	if _, err := verifyWithAppendedRoots(envLeaf, opts, rootFile, "off"); err == nil {
+		t.Fatal("expected SSL_CERT_FILE's root not to be trusted under --system-roots=off")
+	}
+
+	// The default ("merge") mode is the one place SSL_CERT_FILE is expected
+	// to be honored.
+	if _, err := verifyWithAppendedRoots(envLeaf, opts, rootFile, "merge"); err != nil {
+		t.Errorf("expected SSL_CERT_FILE's root to be trusted under --system-roots=merge, got: %v", err)
+	}
+}
+
+// issueLeafRootPEM is a convenience wrapper around issueLeaf for tests that
+// only need a rootsAppend file and don't care about the accompanying leaf.
+func issueLeafRootPEM(t *testing.T) []byte {
+	_, rootPEM := issueLeaf(t, "appended")
+	return rootPEM
+}
@@ -0,0 +1,508 @@
+package certificate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// sctListExtensionOID is the X.509v3 extension (1.3.6.1.4.1.11129.2.4.2)
+// browsers use to carry a certificate's embedded Signed Certificate
+// Timestamps, per RFC 6962 section 3.3.
+var sctListExtensionOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// minSCTDefault is how many valid SCTs from distinct logs --require-sct
+// asks for when given without an explicit count.
+const minSCTDefault = 2
+
+// signedCertificateTimestamp is a single RFC 6962 section 3.2 SCT.
+type signedCertificateTimestamp struct {
+	version       uint8
+	logID         [32]byte
+	timestamp     uint64
+	extensions    []byte
+	hashAlgorithm uint8
+	sigAlgorithm  uint8
+	signature     []byte
+}
+
+// extractSCTs finds the leaf certificate's embedded SCT list extension, if
+// present, and parses every SCT in it.
+func extractSCTs(leaf *x509.Certificate) ([]signedCertificateTimestamp, error) {
+	var raw []byte
+	for _, ext := range leaf.Extensions {
+		if ext.Id.Equal(sctListExtensionOID) {
+			raw = ext.Value
+			break
+		}
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	var octets []byte
+	if _, err := asn1.Unmarshal(raw, &octets); err != nil {
+		return nil, errors.Wrap(err, "failure parsing SCT list extension")
+	}
+
+	return parseSCTList(octets)
+}
+
+// parseSCTList parses the length-prefixed SignedCertificateTimestampList
+// defined in RFC 6962 section 3.3.
+func parseSCTList(b []byte) ([]signedCertificateTimestamp, error) {
+	if len(b) < 2 {
+		return nil, errors.New("SCT list is too short")
+	}
+	listLen := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if len(b) != listLen {
+		return nil, errors.New("SCT list length does not match its contents")
+	}
+
+	var scts []signedCertificateTimestamp
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, errors.New("truncated SCT entry")
+		}
+		sctLen := int(binary.BigEndian.Uint16(b))
+		b = b[2:]
+		if len(b) < sctLen {
+			return nil, errors.New("truncated SCT entry")
+		}
+		sct, err := parseSCT(b[:sctLen])
+		if err != nil {
+			return nil, err
+		}
+		scts = append(scts, sct)
+		b = b[sctLen:]
+	}
+
+	return scts, nil
+}
+
+// parseSCT parses a single RFC 6962 section 3.2 SignedCertificateTimestamp.
+func parseSCT(b []byte) (signedCertificateTimestamp, error) {
+	var sct signedCertificateTimestamp
+	if len(b) < 1+32+8+2 {
+		return sct, errors.New("truncated SCT")
+	}
+
+	sct.version = b[0]
+	copy(sct.logID[:], b[1:33])
+	sct.timestamp = binary.BigEndian.Uint64(b[33:41])
+	b = b[41:]
+
+	extLen := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if len(b) < extLen {
+		return sct, errors.New("truncated SCT extensions")
+	}
+	sct.extensions = b[:extLen]
+	b = b[extLen:]
+
+	if len(b) < 4 {
+		return sct, errors.New("truncated SCT signature")
+	}
+	sct.hashAlgorithm = b[0]
+	sct.sigAlgorithm = b[1]
+	b = b[2:]
+
+	sigLen := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if len(b) != sigLen {
+		return sct, errors.New("SCT signature length does not match its contents")
+	}
+	sct.signature = b
+
+	return sct, nil
+}
+
+// sctDERElement is one TLV (tag, length, value) read off the front of a DER
+// encoded byte string, along with whatever bytes follow it. It is a
+// narrower, unexported copy of the same idea x509util's der.go uses to
+// extract a certificate's Subject without fully parsing it: here it is used
+// to strip a single extension back out of a TBSCertificate.
+type sctDERElement struct {
+	header  []byte
+	content []byte
+	rest    []byte
+}
+
+func (e sctDERElement) raw() []byte {
+	raw := make([]byte, 0, len(e.header)+len(e.content))
+	raw = append(raw, e.header...)
+	raw = append(raw, e.content...)
+	return raw
+}
+
+// readSCTDERElement reads a single TLV off the front of b. It understands
+// only short and long form definite lengths, the only ones a DER
+// certificate ever uses.
+func readSCTDERElement(b []byte) (sctDERElement, error) {
+	if len(b) < 2 {
+		return sctDERElement{}, errors.New("truncated DER element")
+	}
+
+	length := int(b[1])
+	headerLen := 2
+
+	if length&0x80 != 0 {
+		numBytes := length & 0x7f
+		if numBytes == 0 || numBytes > 4 {
+			return sctDERElement{}, errors.New("unsupported DER length encoding")
+		}
+		if len(b) < 2+numBytes {
+			return sctDERElement{}, errors.New("truncated DER length")
+		}
+		length = 0
+		for i := 0; i < numBytes; i++ {
+			length = length<<8 | int(b[2+i])
+		}
+		headerLen = 2 + numBytes
+	}
+
+	if length < 0 || len(b) < headerLen+length {
+		return sctDERElement{}, errors.New("truncated DER element")
+	}
+
+	return sctDERElement{
+		header:  b[:headerLen],
+		content: b[headerLen : headerLen+length],
+		rest:    b[headerLen+length:],
+	}, nil
+}
+
+// wrapSCTDERElement builds a DER encoded TLV with the given tag and
+// content, using definite length form.
+func wrapSCTDERElement(tag byte, content []byte) []byte {
+	length := len(content)
+
+	var lengthBytes []byte
+	if length < 0x80 {
+		lengthBytes = []byte{byte(length)}
+	} else {
+		var n []byte
+		for v := length; v > 0; v >>= 8 {
+			n = append([]byte{byte(v)}, n...)
+		}
+		lengthBytes = append([]byte{0x80 | byte(len(n))}, n...)
+	}
+
+	out := make([]byte, 0, 1+len(lengthBytes)+len(content))
+	out = append(out, tag)
+	out = append(out, lengthBytes...)
+	out = append(out, content...)
+	return out
+}
+
+// asn1ContextTag0 is the tag byte of the TBSCertificate's optional, explicit
+// [0] version field.
+const asn1ContextTag0 = 0xa0
+
+// rebuildPrecertTBS reconstructs the TBSCertificate that the issuing CA
+// actually signed over when computing an embedded SCT: the final
+// certificate's TBSCertificate with the SCT list extension itself removed,
+// per RFC 6962 section 3.2. It edits the raw DER directly, rather than
+// re-marshaling the TBSCertificate, since crypto/x509 does not export a
+// type for it.
+func rebuildPrecertTBS(rawTBS []byte) ([]byte, error) {
+	tbsSeq, err := readSCTDERElement(rawTBS)
+	if err != nil {
+		return nil, err
+	}
+
+	rest := tbsSeq.content
+	var prefix []byte
+
+	consume := func() error {
+		el, err := readSCTDERElement(rest)
+		if err != nil {
+			return err
+		}
+		prefix = append(prefix, rest[:len(rest)-len(el.rest)]...)
+		rest = el.rest
+		return nil
+	}
+
+	if len(rest) > 0 && rest[0] == asn1ContextTag0 {
+		if err := consume(); err != nil { // version
+			return nil, errors.Wrap(err, "malformed TBSCertificate version")
+		}
+	}
+	// serialNumber, signature, issuer, validity, subject, subjectPublicKeyInfo
+	for i := 0; i < 6; i++ {
+		if err := consume(); err != nil {
+			return nil, errors.Wrap(err, "malformed TBSCertificate")
+		}
+	}
+	// issuerUniqueID [1] and subjectUniqueID [2], both rarely present.
+	for len(rest) > 0 && (rest[0] == 0x81 || rest[0] == 0xa1 || rest[0] == 0x82 || rest[0] == 0xa2) {
+		if err := consume(); err != nil {
+			return nil, errors.Wrap(err, "malformed TBSCertificate unique ID")
+		}
+	}
+
+	if len(rest) == 0 || rest[0] != 0xa3 {
+		return nil, errors.New("certificate has no extensions to remove the SCT list from")
+	}
+	extOuter, err := readSCTDERElement(rest)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed TBSCertificate extensions")
+	}
+	extSeq, err := readSCTDERElement(extOuter.content)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed TBSCertificate extensions")
+	}
+
+	var keptExtensions []byte
+	body := extSeq.content
+	for len(body) > 0 {
+		el, err := readSCTDERElement(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "malformed certificate extension")
+		}
+		raw := body[:len(body)-len(el.rest)]
+		body = el.rest
+
+		oid, err := extensionOID(raw)
+		if err != nil {
+			return nil, err
+		}
+		if oid.Equal(sctListExtensionOID) {
+			continue
+		}
+		keptExtensions = append(keptExtensions, raw...)
+	}
+
+	newExtensions := wrapSCTDERElement(0xa3, wrapSCTDERElement(0x30, keptExtensions))
+	return wrapSCTDERElement(0x30, append(append([]byte{}, prefix...), newExtensions...)), nil
+}
+
+// extensionOID reads just the OID out of a raw, DER encoded X.509
+// Extension SEQUENCE.
+func extensionOID(rawExtension []byte) (asn1.ObjectIdentifier, error) {
+	seq, err := readSCTDERElement(rawExtension)
+	if err != nil {
+		return nil, err
+	}
+	oidEl, err := readSCTDERElement(seq.content)
+	if err != nil {
+		return nil, err
+	}
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(oidEl.raw(), &oid); err != nil {
+		return nil, errors.Wrap(err, "malformed extension OID")
+	}
+	return oid, nil
+}
+
+// precertSignedBytes builds the "digitally-signed struct" from RFC 6962
+// section 3.2 that an SCT's signature is computed over, for a certificate
+// with entry_type == precert_entry (the case for every SCT embedded in the
+// final, issued certificate).
+func precertSignedBytes(sct signedCertificateTimestamp, issuer *x509.Certificate, precertTBS []byte) []byte {
+	issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+
+	buf := new(bytes.Buffer)
+	buf.WriteByte(sct.version)
+	buf.WriteByte(0) // signature_type = certificate_timestamp
+	binary.Write(buf, binary.BigEndian, sct.timestamp)
+	buf.Write([]byte{0, 1}) // entry_type = precert_entry, a uint16
+	buf.Write(issuerKeyHash[:])
+
+	tbsLen := len(precertTBS)
+	buf.Write([]byte{byte(tbsLen >> 16), byte(tbsLen >> 8), byte(tbsLen)})
+	buf.Write(precertTBS)
+
+	extLen := len(sct.extensions)
+	buf.Write([]byte{byte(extLen >> 8), byte(extLen)})
+	buf.Write(sct.extensions)
+
+	return buf.Bytes()
+}
+
+// ecdsaSignature is the ASN.1 structure an SCT's signature field holds when
+// sigAlgorithm identifies ECDSA.
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// hashForSCT maps a TLS 1.2 HashAlgorithm value (RFC 5246 section 7.4.1.4.1)
+// to the crypto.Hash SCT signatures are computed with.
+func hashForSCT(alg uint8) (crypto.Hash, error) {
+	switch alg {
+	case 2:
+		return crypto.SHA1, nil
+	case 3:
+		return crypto.SHA224, nil
+	case 4:
+		return crypto.SHA256, nil
+	case 5:
+		return crypto.SHA384, nil
+	case 6:
+		return crypto.SHA512, nil
+	default:
+		return 0, errors.Errorf("unsupported SCT hash algorithm %d", alg)
+	}
+}
+
+// verifySCTSignature checks that signedBytes was signed by pub, matching
+// the hash and signature algorithm sct declares.
+func verifySCTSignature(sct signedCertificateTimestamp, signedBytes []byte, pub interface{}) error {
+	hash, err := hashForSCT(sct.hashAlgorithm)
+	if err != nil {
+		return err
+	}
+	h := hash.New()
+	h.Write(signedBytes)
+	digest := h.Sum(nil)
+
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		if sct.sigAlgorithm != 3 { // ecdsa
+			return errors.Errorf("SCT signature algorithm %d does not match an ECDSA log key", sct.sigAlgorithm)
+		}
+		var sig ecdsaSignature
+		if _, err := asn1.Unmarshal(sct.signature, &sig); err != nil {
+			return errors.Wrap(err, "malformed ECDSA SCT signature")
+		}
+		if !ecdsa.Verify(key, digest, sig.R, sig.S) {
+			return errors.New("invalid SCT signature")
+		}
+	case *rsa.PublicKey:
+		if sct.sigAlgorithm != 1 { // rsa
+			return errors.Errorf("SCT signature algorithm %d does not match an RSA log key", sct.sigAlgorithm)
+		}
+		if err := rsa.VerifyPKCS1v15(key, hash, digest, sct.signature); err != nil {
+			return errors.Wrap(err, "invalid SCT signature")
+		}
+	default:
+		return errors.Errorf("unsupported CT log public key type %T", pub)
+	}
+
+	return nil
+}
+
+// loadCTLogs reads a file of concatenated PEM encoded public keys - one per
+// known log operator - and indexes them by log ID, the SHA-256 hash of
+// each key's DER encoding, as defined in RFC 6962 section 3.2. This repo
+// does not ship a default log list: unlike root certificates, the set of
+// logs browsers currently trust changes too often, and shipping a stale
+// one would silently make --require-sct less useful than it looks.
+func loadCTLogs(file string) (map[[32]byte]interface{}, error) {
+	logs := make(map[[32]byte]interface{})
+	if file == "" {
+		return logs, nil
+	}
+
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failure reading '%s'", file)
+	}
+
+	for {
+		var block *pem.Block
+		block, raw = pem.Decode(raw)
+		if block == nil {
+			break
+		}
+
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failure parsing CT log public key in '%s'", file)
+		}
+		logs[sha256.Sum256(block.Bytes)] = pub
+	}
+
+	return logs, nil
+}
+
+// checkSCTs verifies that leaf carries at least minSCTs valid Signed
+// Certificate Timestamps from distinct logs known to logs. issuer is
+// leaf's direct issuer, needed to compute the issuer_key_hash an SCT's
+// signature is computed over.
+func checkSCTs(leaf, issuer *x509.Certificate, logs map[[32]byte]interface{}, minSCTs int) (int, error) {
+	scts, err := extractSCTs(leaf)
+	if err != nil {
+		return 0, err
+	}
+	if len(scts) == 0 {
+		return 0, errors.Errorf("certificate '%s' has no embedded Signed Certificate Timestamps", leaf.Subject.CommonName)
+	}
+
+	precertTBS, err := rebuildPrecertTBS(leaf.RawTBSCertificate)
+	if err != nil {
+		return 0, errors.Wrap(err, "failure reconstructing precertificate to verify SCT signatures")
+	}
+
+	valid := make(map[[32]byte]bool)
+	for _, sct := range scts {
+		pub, ok := logs[sct.logID]
+		if !ok {
+			continue
+		}
+
+		signedBytes := precertSignedBytes(sct, issuer, precertTBS)
+		if err := verifySCTSignature(sct, signedBytes, pub); err != nil {
+			continue
+		}
+
+		valid[sct.logID] = true
+	}
+
+	if len(valid) < minSCTs {
+		return len(valid), errors.Errorf("certificate '%s' has %d valid Signed Certificate Timestamp(s) from known logs, but %d are required", leaf.Subject.CommonName, len(valid), minSCTs)
+	}
+
+	return len(valid), nil
+}
+
+// requireSCTValue backs the --require-sct flag. It implements cli.Generic
+// so that --require-sct=N sets an explicit count, and the unexported
+// boolFlag interface from the standard flag package (IsBoolFlag), so that a
+// bare --require-sct, with no value, is also accepted and falls back to
+// minSCTDefault - the same trick the standard flag package's own bool
+// flags use to make their value optional.
+type requireSCTValue struct {
+	set   bool
+	count int
+}
+
+func (v *requireSCTValue) String() string {
+	if v == nil || !v.set {
+		return ""
+	}
+	return strconv.Itoa(v.count)
+}
+
+func (v *requireSCTValue) Set(s string) error {
+	if s == "" || s == "true" {
+		v.count = minSCTDefault
+	} else {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return errors.Errorf("invalid value '%s' for flag '--require-sct'; expected an integer", s)
+		}
+		v.count = n
+	}
+	v.set = true
+	return nil
+}
+
+// IsBoolFlag makes the standard flag package, which urfave/cli wraps,
+// accept --require-sct with no value.
+func (v *requireSCTValue) IsBoolFlag() bool {
+	return true
+}
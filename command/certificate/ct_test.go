@@ -0,0 +1,389 @@
+package certificate
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// buildRawSCT lays out a single RFC 6962 section 3.2 SCT with the given
+// fields, in the wire format parseSCT expects.
+func buildRawSCT(t *testing.T, version byte, logID [32]byte, timestamp uint64, extensions, signature []byte) []byte {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	buf.WriteByte(version)
+	buf.Write(logID[:])
+	binary.Write(buf, binary.BigEndian, timestamp)
+	binary.Write(buf, binary.BigEndian, uint16(len(extensions)))
+	buf.Write(extensions)
+	buf.WriteByte(4) // hash algorithm (arbitrary, round-tripped as-is)
+	buf.WriteByte(3) // signature algorithm (arbitrary, round-tripped as-is)
+	binary.Write(buf, binary.BigEndian, uint16(len(signature)))
+	buf.Write(signature)
+	return buf.Bytes()
+}
+
+func TestParseSCT(t *testing.T) {
+	var logID [32]byte
+	logID[0] = 0xAB
+	signature := []byte{0x01, 0x02, 0x03}
+	raw := buildRawSCT(t, 1, logID, 1234567890, nil, signature)
+
+	sct, err := parseSCT(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sct.version != 1 {
+		t.Errorf("version = %d, want 1", sct.version)
+	}
+	if sct.logID != logID {
+		t.Errorf("logID = %x, want %x", sct.logID, logID)
+	}
+	if sct.timestamp != 1234567890 {
+		t.Errorf("timestamp = %d, want 1234567890", sct.timestamp)
+	}
+	if sct.hashAlgorithm != 4 || sct.sigAlgorithm != 3 {
+		t.Errorf("hashAlgorithm/sigAlgorithm = %d/%d, want 4/3", sct.hashAlgorithm, sct.sigAlgorithm)
+	}
+	if !bytes.Equal(sct.signature, signature) {
+		t.Errorf("signature = %x, want %x", sct.signature, signature)
+	}
+}
+
+func TestParseSCT_Truncated(t *testing.T) {
+	var logID [32]byte
+	raw := buildRawSCT(t, 1, logID, 1, nil, []byte{0x01, 0x02})
+	if _, err := parseSCT(raw[:len(raw)-1]); err == nil {
+		t.Fatal("expected an error for a truncated SCT")
+	}
+}
+
+func TestParseSCTList(t *testing.T) {
+	var logA, logB [32]byte
+	logA[0] = 0xAA
+	logB[0] = 0xBB
+
+	sct1 := buildRawSCT(t, 1, logA, 100, nil, []byte{0x01})
+	sct2 := buildRawSCT(t, 1, logB, 200, nil, []byte{0x02, 0x03})
+
+	list := new(bytes.Buffer)
+	entries := new(bytes.Buffer)
+	for _, sct := range [][]byte{sct1, sct2} {
+		binary.Write(entries, binary.BigEndian, uint16(len(sct)))
+		entries.Write(sct)
+	}
+	binary.Write(list, binary.BigEndian, uint16(entries.Len()))
+	list.Write(entries.Bytes())
+
+	scts, err := parseSCTList(list.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(scts) != 2 {
+		t.Fatalf("got %d SCTs, want 2", len(scts))
+	}
+	if scts[0].logID != logA || scts[1].logID != logB {
+		t.Errorf("SCTs decoded out of order: %x, %x", scts[0].logID, scts[1].logID)
+	}
+}
+
+func TestParseSCTList_LengthMismatch(t *testing.T) {
+	// Declares a 10-byte list but provides fewer bytes.
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, uint16(10))
+	buf.Write([]byte{0x01, 0x02})
+
+	if _, err := parseSCTList(buf.Bytes()); err == nil {
+		t.Fatal("expected an error for a length/contents mismatch")
+	}
+}
+
+func TestReadSCTDERElement_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{"empty", nil},
+		{"short form", bytes.Repeat([]byte{0xAA}, 100)},
+		{"long form, one length byte", bytes.Repeat([]byte{0xBB}, 200)},
+		{"long form, two length bytes", bytes.Repeat([]byte{0xCC}, 300)},
+		{"long form, three length bytes", bytes.Repeat([]byte{0xDD}, 70000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapped := wrapSCTDERElement(0x30, tt.content)
+			el, err := readSCTDERElement(append(append([]byte{}, wrapped...), 0xFF, 0xFF))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(el.content, tt.content) {
+				t.Errorf("content round-trip mismatch: got %d bytes, want %d", len(el.content), len(tt.content))
+			}
+			if !bytes.Equal(el.rest, []byte{0xFF, 0xFF}) {
+				t.Errorf("rest = %x, want trailing marker bytes", el.rest)
+			}
+			if !bytes.Equal(el.raw(), wrapped) {
+				t.Errorf("raw() did not reproduce the original element")
+			}
+		})
+	}
+}
+
+func TestReadSCTDERElement_Truncated(t *testing.T) {
+	if _, err := readSCTDERElement([]byte{0x30}); err == nil {
+		t.Fatal("expected an error for a truncated element")
+	}
+	if _, err := readSCTDERElement([]byte{0x30, 0x05, 0x01, 0x02}); err == nil {
+		t.Fatal("expected an error when content is shorter than the declared length")
+	}
+}
+
+func TestRequireSCTValue(t *testing.T) {
+	t.Run("bare flag defaults to minSCTDefault", func(t *testing.T) {
+		var v requireSCTValue
+		if err := v.Set(""); err != nil {
+			t.Fatal(err)
+		}
+		if v.count != minSCTDefault || !v.set {
+			t.Errorf("got count=%d set=%v, want count=%d set=true", v.count, v.set, minSCTDefault)
+		}
+	})
+
+	t.Run("explicit count", func(t *testing.T) {
+		var v requireSCTValue
+		if err := v.Set("3"); err != nil {
+			t.Fatal(err)
+		}
+		if v.count != 3 {
+			t.Errorf("count = %d, want 3", v.count)
+		}
+	})
+
+	t.Run("non-integer value is rejected", func(t *testing.T) {
+		var v requireSCTValue
+		if err := v.Set("many"); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("IsBoolFlag makes the value optional", func(t *testing.T) {
+		var v requireSCTValue
+		if !v.IsBoolFlag() {
+			t.Error("expected IsBoolFlag to return true")
+		}
+	})
+}
+
+// sctTamperMarkerOID is an arbitrary, non-SCT extension embedded in the test
+// certificates below alongside the real SCT list extension, so a test can
+// tamper with it after issuance without touching the SCT bytes themselves.
+var sctTamperMarkerOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5}
+var sctTamperMarkerValue = []byte("sct-end-to-end-test-marker")
+
+// issueCertWithSCT builds a self-signed issuer, a log keypair, and a leaf
+// the issuer signs with a genuine embedded SCT: it first issues a
+// precertificate (the leaf's contents minus the SCT list extension) to get
+// the exact TBSCertificate bytes an SCT signs over, signs those bytes with
+// the log key, and then embeds the resulting SCT in the final, issued leaf -
+// mirroring what rebuildPrecertTBS expects to reconstruct.
+func issueCertWithSCT(t *testing.T) (leaf, issuer *x509.Certificate, logPub *ecdsa.PublicKey, logID [32]byte) {
+	t.Helper()
+
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "issuer"},
+		NotBefore:             time.Unix(0, 0),
+		NotAfter:              time.Unix(0, 0).Add(100 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	issuerDER, err := x509.CreateCertificate(rand.Reader, issuerTemplate, issuerTemplate, &issuerKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err = x509.ParseCertificate(issuerDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logPub = &logKey.PublicKey
+	logPubDER, err := x509.MarshalPKIXPublicKey(logPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logID = sha256.Sum256(logPubDER)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	precertTemplate := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		Subject:         pkix.Name{CommonName: "leaf"},
+		NotBefore:       time.Unix(0, 0),
+		NotAfter:        time.Unix(0, 0).Add(100 * 365 * 24 * time.Hour),
+		ExtraExtensions: []pkix.Extension{{Id: sctTamperMarkerOID, Value: sctTamperMarkerValue}},
+	}
+	precertDER, err := x509.CreateCertificate(rand.Reader, precertTemplate, issuer, &leafKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	precert, err := x509.ParseCertificate(precertDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const timestamp = 1700000000000
+	sct := signedCertificateTimestamp{logID: logID, timestamp: timestamp, hashAlgorithm: 4, sigAlgorithm: 3}
+	digest := sha256.Sum256(precertSignedBytes(sct, issuer, precert.RawTBSCertificate))
+	r, s, err := ecdsa.Sign(rand.Reader, logKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := asn1.Marshal(ecdsaSignature{R: r, S: s})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sctWire := buildRawSCT(t, sct.version, logID, timestamp, nil, sig)
+	list := new(bytes.Buffer)
+	entries := new(bytes.Buffer)
+	binary.Write(entries, binary.BigEndian, uint16(len(sctWire)))
+	entries.Write(sctWire)
+	binary.Write(list, binary.BigEndian, uint16(entries.Len()))
+	list.Write(entries.Bytes())
+
+	sctListExtValue, err := asn1.Marshal(list.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	finalTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Unix(0, 0).Add(100 * 365 * 24 * time.Hour),
+		ExtraExtensions: []pkix.Extension{
+			{Id: sctTamperMarkerOID, Value: sctTamperMarkerValue},
+			{Id: sctListExtensionOID, Value: sctListExtValue},
+		},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, finalTemplate, issuer, &leafKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err = x509.ParseCertificate(leafDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return leaf, issuer, logPub, logID
+}
+
+// flipByteIn returns a copy of der with one byte inverted inside the first
+// occurrence of marker, so a test can invalidate a specific field (the SCT
+// signature, an unrelated extension, ...) without disturbing the rest of a
+// parseable certificate.
+func flipByteIn(t *testing.T, der, marker []byte) []byte {
+	t.Helper()
+	idx := bytes.Index(der, marker)
+	if idx < 0 {
+		t.Fatal("marker not found in certificate DER")
+	}
+	tampered := make([]byte, len(der))
+	copy(tampered, der)
+	tampered[idx] ^= 0xFF
+	return tampered
+}
+
+// TestCheckSCTs_EndToEnd builds a real certificate with a genuinely signed,
+// embedded SCT and confirms checkSCTs both accepts it and rejects the ways
+// it could be forged: a bad signature, an extension changed since the SCT
+// was issued, or checking it against the wrong issuer.
+func TestCheckSCTs_EndToEnd(t *testing.T) {
+	leaf, issuer, logPub, logID := issueCertWithSCT(t)
+	logs := map[[32]byte]interface{}{logID: logPub}
+
+	t.Run("valid SCT verifies", func(t *testing.T) {
+		n, err := checkSCTs(leaf, issuer, logs, 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n != 1 {
+			t.Errorf("valid count = %d, want 1", n)
+		}
+	})
+
+	t.Run("tampered signature is rejected", func(t *testing.T) {
+		scts, err := extractSCTs(leaf)
+		if err != nil || len(scts) != 1 {
+			t.Fatalf("expected to extract the one embedded SCT, got %v, %v", scts, err)
+		}
+		tampered, err := x509.ParseCertificate(flipByteIn(t, leaf.Raw, scts[0].signature))
+		if err != nil {
+			t.Fatalf("tampering broke DER parsing: %v", err)
+		}
+		if n, err := checkSCTs(tampered, issuer, logs, 1); err == nil || n != 0 {
+			t.Errorf("got n=%d, err=%v; want a rejected signature", n, err)
+		}
+	})
+
+	t.Run("tampered extension is rejected", func(t *testing.T) {
+		tampered, err := x509.ParseCertificate(flipByteIn(t, leaf.Raw, sctTamperMarkerValue))
+		if err != nil {
+			t.Fatalf("tampering broke DER parsing: %v", err)
+		}
+		if n, err := checkSCTs(tampered, issuer, logs, 1); err == nil || n != 0 {
+			t.Errorf("got n=%d, err=%v; want rejection of a certificate whose extensions changed since the SCT was issued", n, err)
+		}
+	})
+
+	t.Run("wrong issuer is rejected", func(t *testing.T) {
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherTemplate := &x509.Certificate{
+			SerialNumber:          big.NewInt(9),
+			Subject:               pkix.Name{CommonName: "other-issuer"},
+			NotBefore:             time.Unix(0, 0),
+			NotAfter:              time.Unix(0, 0).Add(100 * 365 * 24 * time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+		otherDER, err := x509.CreateCertificate(rand.Reader, otherTemplate, otherTemplate, &otherKey.PublicKey, otherKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherIssuer, err := x509.ParseCertificate(otherDER)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n, err := checkSCTs(leaf, otherIssuer, logs, 1); err == nil || n != 0 {
+			t.Errorf("got n=%d, err=%v; want rejection against the wrong issuer", n, err)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package certificate
+
+import (
+	"crypto/x509"
+	"reflect"
+	"testing"
+)
+
+func TestPurposesToKeyUsages(t *testing.T) {
+	tests := []struct {
+		name      string
+		purposes  []string
+		want      []x509.ExtKeyUsage
+		wantError bool
+	}{
+		{"no flags defaults to any", nil, []x509.ExtKeyUsage{x509.ExtKeyUsageAny}, false},
+		{"single purpose", []string{"server"}, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, false},
+		{
+			"repeated flag",
+			[]string{"server", "client"},
+			[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			false,
+		},
+		{"unknown purpose", []string{"bogus"}, nil, true},
+		{"case-sensitive", []string{"Server"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := purposesToKeyUsages(tt.purposes)
+			if tt.wantError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
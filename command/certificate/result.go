@@ -0,0 +1,119 @@
+package certificate
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// verifyResult is the structure printed by `step certificate verify
+// --format=json`. It reports everything a caller would otherwise have to
+// infer from the command's exit code and stderr output, so it can be
+// consumed by CI gates and monitoring.
+type verifyResult struct {
+	Valid      bool               `json:"valid"`
+	Errors     []string           `json:"errors,omitempty"`
+	Leaf       certSummary        `json:"leaf"`
+	Lifetime   lifetimeSummary    `json:"lifetime"`
+	Chains     [][]certSummary    `json:"chains,omitempty"`
+	Revocation []revocationResult `json:"revocation,omitempty"`
+	SCT        *sctSummary        `json:"sct,omitempty"`
+}
+
+// sctSummary is the outcome of a --require-sct check.
+type sctSummary struct {
+	Required int `json:"required"`
+	Valid    int `json:"valid"`
+}
+
+// certSummary is the JSON representation of a single certificate, leaf or
+// intermediate, in the chain.
+type certSummary struct {
+	Subject           string    `json:"subject"`
+	Issuer            string    `json:"issuer"`
+	SANs              []string  `json:"sans,omitempty"`
+	SerialNumber      string    `json:"serial_number"`
+	NotBefore         time.Time `json:"not_before"`
+	NotAfter          time.Time `json:"not_after"`
+	SubjectKeyID      string    `json:"subject_key_id,omitempty"`
+	AuthorityKeyID    string    `json:"authority_key_id,omitempty"`
+	SHA1Fingerprint   string    `json:"sha1_fingerprint"`
+	SHA256Fingerprint string    `json:"sha256_fingerprint"`
+}
+
+// lifetimeSummary replaces the terminal-color "verdancy" indicator with
+// plain, scriptable values.
+type lifetimeSummary struct {
+	PercentUsed int    `json:"lifetime_percent_used"`
+	Remaining   string `json:"remaining"`
+}
+
+// revocationResult is the per-certificate outcome of a CRL/OCSP revocation
+// check, as performed by checkRevocationDetailed.
+type revocationResult struct {
+	Subject string `json:"subject"`
+	Status  string `json:"status"` // good, revoked, unknown
+	Error   string `json:"error,omitempty"`
+}
+
+func newCertSummary(cert *x509.Certificate) certSummary {
+	sha1sum := sha1.Sum(cert.Raw)
+	sha256sum := sha256.Sum256(cert.Raw)
+
+	return certSummary{
+		Subject:           cert.Subject.String(),
+		Issuer:            cert.Issuer.String(),
+		SANs:              subjectAltNames(cert),
+		SerialNumber:      cert.SerialNumber.String(),
+		NotBefore:         cert.NotBefore,
+		NotAfter:          cert.NotAfter,
+		SubjectKeyID:      fmt.Sprintf("%x", cert.SubjectKeyId),
+		AuthorityKeyID:    fmt.Sprintf("%x", cert.AuthorityKeyId),
+		SHA1Fingerprint:   fmt.Sprintf("%x", sha1sum),
+		SHA256Fingerprint: fmt.Sprintf("%x", sha256sum),
+	}
+}
+
+func subjectAltNames(cert *x509.Certificate) []string {
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
+
+// lifetimeFor computes how much of cert's validity window, measured from
+// now, has already elapsed.
+func lifetimeFor(cert *x509.Certificate, now time.Time) lifetimeSummary {
+	total := cert.NotAfter.Sub(cert.NotBefore)
+	remaining := cert.NotAfter.Sub(now)
+
+	percentUsed := 100
+	if total > 0 {
+		percentUsed = int((1 - remaining.Hours()/total.Hours()) * 100)
+	}
+
+	return lifetimeSummary{
+		PercentUsed: percentUsed,
+		Remaining:   remaining.String(),
+	}
+}
+
+// printVerifyResult marshals result as indented JSON to stdout.
+func printVerifyResult(result verifyResult) error {
+	raw, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stdout, string(raw))
+	return nil
+}
@@ -0,0 +1,121 @@
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func selfSignedCert(t *testing.T, template *x509.Certificate) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestSubjectAltNames(t *testing.T) {
+	uri, err := url.Parse("spiffe://example.com/workload")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := selfSignedCert(t, &x509.Certificate{
+		SerialNumber:   big.NewInt(1),
+		Subject:        pkix.Name{CommonName: "leaf"},
+		NotBefore:      time.Unix(0, 0),
+		NotAfter:       time.Unix(0, 0).Add(time.Hour),
+		DNSNames:       []string{"example.com", "www.example.com"},
+		EmailAddresses: []string{"admin@example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("127.0.0.1")},
+		URIs:           []*url.URL{uri},
+	})
+
+	want := []string{"example.com", "www.example.com", "admin@example.com", "127.0.0.1", "spiffe://example.com/workload"}
+	if got := subjectAltNames(cert); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSubjectAltNames_None(t *testing.T) {
+	cert := selfSignedCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Unix(0, 0).Add(time.Hour),
+	})
+	if got := subjectAltNames(cert); got != nil {
+		t.Errorf("expected no SANs, got %v", got)
+	}
+}
+
+func TestNewCertSummary(t *testing.T) {
+	cert := selfSignedCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(7),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		Issuer:       pkix.Name{CommonName: "leaf"},
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Unix(0, 0).Add(time.Hour),
+		DNSNames:     []string{"example.com"},
+	})
+
+	summary := newCertSummary(cert)
+	if summary.Subject != cert.Subject.String() {
+		t.Errorf("Subject = %q, want %q", summary.Subject, cert.Subject.String())
+	}
+	if summary.SerialNumber != "7" {
+		t.Errorf("SerialNumber = %q, want %q", summary.SerialNumber, "7")
+	}
+	if !reflect.DeepEqual(summary.SANs, []string{"example.com"}) {
+		t.Errorf("SANs = %v, want [example.com]", summary.SANs)
+	}
+	if len(summary.SHA1Fingerprint) != 40 {
+		t.Errorf("SHA1Fingerprint has length %d, want 40", len(summary.SHA1Fingerprint))
+	}
+	if len(summary.SHA256Fingerprint) != 64 {
+		t.Errorf("SHA256Fingerprint has length %d, want 64", len(summary.SHA256Fingerprint))
+	}
+}
+
+func TestLifetimeFor(t *testing.T) {
+	notBefore := time.Unix(0, 0)
+	notAfter := notBefore.Add(100 * time.Hour)
+	cert := &x509.Certificate{NotBefore: notBefore, NotAfter: notAfter}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want int
+	}{
+		{"at issuance", notBefore, 0},
+		{"halfway through", notBefore.Add(50 * time.Hour), 50},
+		{"at expiry", notAfter, 100},
+		{"past expiry", notAfter.Add(time.Hour), 101},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lifetimeFor(cert, tt.now)
+			if got.PercentUsed != tt.want {
+				t.Errorf("PercentUsed = %d, want %d", got.PercentUsed, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package certificate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/config"
+	"golang.org/x/crypto/ocsp"
+)
+
+// revocationMode controls how verifyAction reacts to a revocation check
+// that cannot be completed (e.g. the CRL/OCSP responder is unreachable).
+type revocationMode string
+
+const (
+	revocationHardFail revocationMode = "on"
+	revocationSoftFail revocationMode = "soft-fail"
+	revocationOff      revocationMode = "off"
+)
+
+// revocationCacheDir is where cached OCSP/CRL responses are stored, relative
+// to $STEPPATH, so repeated verifications of the same chain don't hammer the
+// issuer's responder.
+const revocationCacheDir = "revocation-cache"
+
+// checkRevocation walks every certificate in chain (skipping the root,
+// which terminates the chain and has no issuer to ask) and makes sure it
+// has not been revoked, using an explicit CRL source if one was given and
+// falling back to OCSP and the certificate's own CRLDistributionPoints
+// otherwise.
+//
+// ocspMode of revocationOff skips the checks entirely. revocationSoftFail
+// prints a warning and continues past any network or parsing error;
+// revocationHardFail (the default) returns the first such error.
+func checkRevocation(chain []*x509.Certificate, crlSource string, ocspMode revocationMode) error {
+	if ocspMode == revocationOff {
+		return nil
+	}
+
+	cache, err := newRevocationCache()
+	if err != nil {
+		return errors.Wrap(err, "failure opening revocation cache")
+	}
+
+	for i := 0; i < len(chain)-1; i++ {
+		leaf, issuer := chain[i], chain[i+1]
+
+		err := checkCertRevocation(leaf, issuer, crlSource, cache)
+		if err == nil {
+			continue
+		}
+		if _, revoked := err.(*revokedError); !revoked && ocspMode == revocationSoftFail {
+			fmt.Fprintf(os.Stderr, "warning: could not verify revocation status of '%s': %v\n", leaf.Subject.CommonName, err)
+			continue
+		}
+		return err
+	}
+
+	return nil
+}
+
+// checkCertRevocation checks a single non-root certificate against a CRL
+// (explicit or discovered) and, if the certificate is still unaccounted
+// for, against OCSP.
+func checkCertRevocation(leaf, issuer *x509.Certificate, crlSource string, cache *revocationCache) error {
+	if crlSource != "" {
+		return checkCRL(leaf, issuer, crlSource)
+	}
+
+	var lastCRLErr error
+	for _, dp := range leaf.CRLDistributionPoints {
+		err := checkCRL(leaf, issuer, dp)
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(*revokedError); ok {
+			return err
+		}
+		lastCRLErr = err
+	}
+
+	if len(leaf.OCSPServer) == 0 {
+		if lastCRLErr != nil {
+			return errors.Wrapf(lastCRLErr, "'%s' has no OCSPServer to fall back to and every CRLDistributionPoint failed", leaf.Subject.CommonName)
+		}
+		return errors.Errorf("'%s' has no CRLDistributionPoints or OCSPServer to check for revocation", leaf.Subject.CommonName)
+	}
+
+	return checkOCSP(leaf, issuer, cache)
+}
+
+// revokedError is returned by checkCRL and evalOCSPResponse when a
+// certificate is confirmed revoked, as opposed to when its status simply
+// couldn't be determined. A type assertion is used to tell the two apart
+// when reporting a per-certificate revocation status (see
+// checkRevocationDetailed) and when deciding whether to keep trying other
+// CRLDistributionPoints (see checkCertRevocation).
+type revokedError struct {
+	msg string
+}
+
+func (e *revokedError) Error() string {
+	return e.msg
+}
+
+// checkCRL loads a CRL from a local file or an http(s) URL, verifies its
+// signature against issuer, and fails if leaf's serial number appears among
+// the RevokedCertificates.
+func checkCRL(leaf, issuer *x509.Certificate, source string) error {
+	der, err := loadCRL(source)
+	if err != nil {
+		return errors.Wrapf(err, "failure loading CRL from '%s'", source)
+	}
+
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return errors.Wrapf(err, "failure parsing CRL from '%s'", source)
+	}
+
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return errors.Wrapf(err, "CRL from '%s' is not signed by '%s'", source, issuer.Subject.CommonName)
+	}
+
+	for _, rc := range crl.RevokedCertificates {
+		if rc.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+			return &revokedError{fmt.Sprintf("certificate '%s' was revoked on %s", leaf.Subject.CommonName, rc.RevocationTime)}
+		}
+	}
+
+	return nil
+}
+
+func loadCRL(source string) ([]byte, error) {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		resp, err := http.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+		return ioutil.ReadAll(resp.Body)
+	}
+	return ioutil.ReadFile(source)
+}
+
+// checkOCSP asks issuer's OCSP responder about leaf's status, using and
+// populating cache so subsequent verifications of the same certificate
+// don't need to hit the network again before the response's NextUpdate.
+func checkOCSP(leaf, issuer *x509.Certificate, cache *revocationCache) error {
+	if cached, ok := cache.get(issuer, leaf); ok {
+		return evalOCSPResponse(leaf, cached)
+	}
+
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return errors.Wrap(err, "failure creating OCSP request")
+	}
+
+	httpResp, err := http.Post(leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return errors.Wrapf(err, "failure contacting OCSP responder '%s'", leaf.OCSPServer[0])
+	}
+	defer httpResp.Body.Close()
+
+	body, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return errors.Wrap(err, "failure reading OCSP response")
+	}
+
+	resp, err := ocsp.ParseResponse(body, issuer)
+	if err != nil {
+		return errors.Wrap(err, "failure parsing OCSP response")
+	}
+
+	now := time.Now()
+	if now.Before(resp.ThisUpdate) || (!resp.NextUpdate.IsZero() && now.After(resp.NextUpdate)) {
+		return errors.Errorf("OCSP response for '%s' is not valid at this time", leaf.Subject.CommonName)
+	}
+
+	if err := cache.put(issuer, leaf, resp); err != nil {
+		return errors.Wrap(err, "failure writing revocation cache")
+	}
+
+	return evalOCSPResponse(leaf, resp)
+}
+
+func evalOCSPResponse(leaf *x509.Certificate, resp *ocsp.Response) error {
+	if resp.Status == ocsp.Revoked {
+		return &revokedError{fmt.Sprintf("certificate '%s' was revoked on %s", leaf.Subject.CommonName, resp.RevokedAt)}
+	}
+	return nil
+}
+
+// checkRevocationDetailed runs the same checks as checkRevocation but never
+// stops at the first failure, returning one revocationResult per
+// non-root certificate in chain. It's used to populate the structured
+// output produced by --format=json. A type assertion, rather than
+// errors.As, is used to recognize a revokedError because this repo's
+// pinned version of github.com/pkg/errors predates Go 1.13 error wrapping.
+func checkRevocationDetailed(chain []*x509.Certificate, crlSource string, ocspMode revocationMode) []revocationResult {
+	var results []revocationResult
+	if ocspMode == revocationOff || len(chain) < 2 {
+		return results
+	}
+
+	cache, err := newRevocationCache()
+	if err != nil {
+		return []revocationResult{{Status: "unknown", Error: err.Error()}}
+	}
+
+	for i := 0; i < len(chain)-1; i++ {
+		leaf := chain[i]
+		result := revocationResult{Subject: leaf.Subject.String(), Status: "good"}
+
+		if err := checkCertRevocation(leaf, chain[i+1], crlSource, cache); err != nil {
+			result.Error = err.Error()
+			if _, ok := err.(*revokedError); ok {
+				result.Status = "revoked"
+			} else {
+				result.Status = "unknown"
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// revocationCache is a small on-disk cache of OCSP responses, keyed by
+// issuer+serial, so `step certificate verify` doesn't have to round-trip to
+// the responder every time it's run against the same chain.
+type revocationCache struct {
+	dir string
+}
+
+type cachedOCSPResponse struct {
+	Status     int       `json:"status"`
+	RevokedAt  time.Time `json:"revokedAt"`
+	ThisUpdate time.Time `json:"thisUpdate"`
+	NextUpdate time.Time `json:"nextUpdate"`
+}
+
+func newRevocationCache() (*revocationCache, error) {
+	dir := filepath.Join(config.StepPath(), revocationCacheDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &revocationCache{dir: dir}, nil
+}
+
+func (c *revocationCache) key(issuer, leaf *x509.Certificate) string {
+	h := sha256.Sum256(append(issuer.RawSubject, leaf.SerialNumber.Bytes()...))
+	return hex.EncodeToString(h[:])
+}
+
+func (c *revocationCache) get(issuer, leaf *x509.Certificate) (*ocsp.Response, bool) {
+	raw, err := ioutil.ReadFile(filepath.Join(c.dir, c.key(issuer, leaf)))
+	if err != nil {
+		return nil, false
+	}
+
+	var entry cachedOCSPResponse
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil, false
+	}
+	if time.Now().After(entry.NextUpdate) {
+		return nil, false
+	}
+
+	return &ocsp.Response{
+		Status:     entry.Status,
+		RevokedAt:  entry.RevokedAt,
+		ThisUpdate: entry.ThisUpdate,
+		NextUpdate: entry.NextUpdate,
+	}, true
+}
+
+func (c *revocationCache) put(issuer, leaf *x509.Certificate, resp *ocsp.Response) error {
+	entry := cachedOCSPResponse{
+		Status:     resp.Status,
+		RevokedAt:  resp.RevokedAt,
+		ThisUpdate: resp.ThisUpdate,
+		NextUpdate: resp.NextUpdate,
+	}
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(c.dir, c.key(issuer, leaf)), raw, 0600)
+}
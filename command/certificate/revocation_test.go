@@ -0,0 +1,227 @@
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setupCRLChain builds a self-signed CA, a leaf it issues, and a CRL file
+// signed by that CA. If revoke is true, the leaf's serial number is listed
+// among the CRL's revoked certificates.
+func setupCRLChain(t *testing.T, revoke bool) (leaf, issuer *x509.Certificate, crlFile string) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "root"},
+		NotBefore:             time.Unix(0, 0),
+		NotAfter:              time.Unix(0, 0).Add(100 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err = x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Unix(0, 0).Add(100 * 365 * 24 * time.Hour),
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, issuer, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err = x509.ParseCertificate(leafDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var revoked []pkix.RevokedCertificate
+	if revoke {
+		revoked = []pkix.RevokedCertificate{{
+			SerialNumber:   leaf.SerialNumber,
+			RevocationTime: time.Unix(0, 0).Add(24 * time.Hour),
+		}}
+	}
+	crlDER, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:              big.NewInt(1),
+		ThisUpdate:          time.Unix(0, 0),
+		NextUpdate:          time.Unix(0, 0).Add(24 * time.Hour),
+		RevokedCertificates: revoked,
+	}, issuer, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "x509util-crl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	crlFile = filepath.Join(dir, "root.crl")
+	if err := ioutil.WriteFile(crlFile, crlDER, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return leaf, issuer, crlFile
+}
+
+func TestCheckCertRevocation_CRLDistributionPoints(t *testing.T) {
+	t.Run("revoked", func(t *testing.T) {
+		leaf, issuer, crlFile := setupCRLChain(t, true)
+		leaf.CRLDistributionPoints = []string{crlFile}
+
+		err := checkCertRevocation(leaf, issuer, "", nil)
+		if _, ok := err.(*revokedError); !ok {
+			t.Fatalf("expected a *revokedError, got %#v", err)
+		}
+	})
+
+	t.Run("good", func(t *testing.T) {
+		leaf, issuer, crlFile := setupCRLChain(t, false)
+		leaf.CRLDistributionPoints = []string{crlFile}
+
+		if err := checkCertRevocation(leaf, issuer, "", nil); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("revoked CRL takes priority over an unreachable one", func(t *testing.T) {
+		// A leaf naming two distribution points, the first broken and the
+		// second correctly reporting revocation, must still be reported as
+		// revoked rather than falling through past the confirmed result.
+		leaf, issuer, crlFile := setupCRLChain(t, true)
+		leaf.CRLDistributionPoints = []string{filepath.Join(os.TempDir(), "does-not-exist.crl"), crlFile}
+
+		err := checkCertRevocation(leaf, issuer, "", nil)
+		if _, ok := err.(*revokedError); !ok {
+			t.Fatalf("expected a *revokedError, got %#v", err)
+		}
+	})
+
+	t.Run("no revocation info", func(t *testing.T) {
+		leaf, issuer, _ := setupCRLChain(t, false)
+
+		err := checkCertRevocation(leaf, issuer, "", nil)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if _, ok := err.(*revokedError); ok {
+			t.Fatal("expected a plain error, not a *revokedError")
+		}
+	})
+
+	t.Run("every CRLDistributionPoint fails and there is no OCSPServer", func(t *testing.T) {
+		// leaf does have a CRLDistributionPoint, it's just unreachable; the
+		// error must say so rather than falsely claiming there was nothing
+		// to check for revocation.
+		leaf, issuer, _ := setupCRLChain(t, false)
+		leaf.CRLDistributionPoints = []string{filepath.Join(os.TempDir(), "does-not-exist.crl")}
+
+		err := checkCertRevocation(leaf, issuer, "", nil)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if _, ok := err.(*revokedError); ok {
+			t.Fatal("expected a plain error, not a *revokedError")
+		}
+		if strings.Contains(err.Error(), "no CRLDistributionPoints") {
+			t.Errorf("error falsely claims there were no CRLDistributionPoints: %v", err)
+		}
+		if !strings.Contains(err.Error(), "does-not-exist.crl") {
+			t.Errorf("expected the error to surface the CRL failure, got: %v", err)
+		}
+	})
+}
+
+func TestCheckCRL(t *testing.T) {
+	t.Run("signed by the wrong issuer", func(t *testing.T) {
+		leaf, _, crlFile := setupCRLChain(t, true)
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherTemplate := &x509.Certificate{
+			SerialNumber:          big.NewInt(2),
+			Subject:               pkix.Name{CommonName: "other-root"},
+			NotBefore:             time.Unix(0, 0),
+			NotAfter:              time.Unix(0, 0).Add(100 * 365 * 24 * time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		}
+		otherDER, err := x509.CreateCertificate(rand.Reader, otherTemplate, otherTemplate, &otherKey.PublicKey, otherKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherIssuer, err := x509.ParseCertificate(otherDER)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = checkCRL(leaf, otherIssuer, crlFile)
+		if err == nil {
+			t.Fatal("expected a signature verification error")
+		}
+		if _, ok := err.(*revokedError); ok {
+			t.Fatal("a bad signature must not be reported as a revokedError")
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		leaf, issuer, _ := setupCRLChain(t, false)
+		if err := checkCRL(leaf, issuer, filepath.Join(os.TempDir(), "does-not-exist.crl")); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestCheckRevocation_Modes(t *testing.T) {
+	leaf, issuer, _ := setupCRLChain(t, false) // no CRLDistributionPoints or OCSPServer -> always errors
+	chain := []*x509.Certificate{leaf, issuer}
+
+	t.Run("hard-fail returns the error", func(t *testing.T) {
+		if err := checkRevocation(chain, "", revocationHardFail); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("soft-fail swallows the error", func(t *testing.T) {
+		if err := checkRevocation(chain, "", revocationSoftFail); err != nil {
+			t.Fatalf("expected soft-fail to swallow the error, got %v", err)
+		}
+	})
+
+	t.Run("off skips the check entirely", func(t *testing.T) {
+		if err := checkRevocation(chain, "", revocationOff); err != nil {
+			t.Fatalf("expected off to skip the check, got %v", err)
+		}
+	})
+}
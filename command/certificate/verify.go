@@ -74,6 +74,54 @@ Verify the remaining validity of a certificate using a custom root certificate a
 '''
 $ step certificate verify ./certificate.crt --host smallstep.com --verdancy
 '''
+
+Verify a certificate has not been revoked, consulting its CRL distribution
+points and OCSP responder:
+
+'''
+$ step certificate verify ./certificate.crt --ocsp=on
+'''
+
+Verify a certificate against an explicit CRL, without failing the command if
+the CRL cannot be reached:
+
+'''
+$ step certificate verify ./certificate.crt --crl ./root.crl --ocsp=soft-fail
+'''
+
+Verify that a certificate is valid for TLS client authentication:
+
+'''
+$ step certificate verify ./certificate.crt --purpose client
+'''
+
+Verify a certificate against the operating system's root certificate bundle
+plus a private root, succeeding if either trusts the chain:
+
+'''
+$ step certificate verify ./certificate.crt --roots-append ./private-root.crt
+'''
+
+Verify a certificate and print a structured result for use in scripts or a
+CI pipeline:
+
+'''
+$ step certificate verify ./certificate.crt --format json
+'''
+
+Verify a certificate against an alternate trust bundle, without touching the
+operating system's root store, inside a distroless container:
+
+'''
+$ SSL_CERT_FILE=/etc/ssl/custom-ca.pem step certificate verify ./certificate.crt --system-roots replace
+'''
+
+Verify that a certificate carries at least two valid Certificate
+Transparency timestamps from logs you trust:
+
+'''
+$ step certificate verify ./certificate.crt --require-sct --ct-logs ./ct-logs.pem
+'''
 `,
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -99,6 +147,129 @@ authenticity of the remote server.
 
     **directory**
 	:  Relative or full path to a directory. Every PEM encoded certificate from each file in the directory will be used for path validation.`,
+			},
+			cli.StringFlag{
+				Name: "system-roots",
+				Usage: `Controls how the operating system's root certificate bundle is
+used when **--roots** is not given. <system-roots> is a case-sensitive
+string and must be one of:
+
+    **merge** (default)
+	:  Use the operating system's root certificate bundle, merged with any
+	roots named by the 'STEP_SSL_CERT_FILE', 'SSL_CERT_FILE', or
+	'SSL_CERT_DIR' environment variables.
+
+    **replace**
+	:  Ignore the operating system's root certificate bundle and use only
+	the roots named by those environment variables.
+
+    **off**
+	:  Use the operating system's root certificate bundle as-is, ignoring
+	those environment variables.`,
+				Value: "merge",
+			},
+			cli.StringFlag{
+				Name: "roots-append",
+				Usage: `Root certificate(s) that will be merged with the operating
+system's default root certificate bundle (or, if **--roots** is also given,
+with that pool) and used, in addition to it, to verify the authenticity of
+the remote server. Accepts the same <roots> syntax as **--roots**. Unlike
+**--roots**, the system roots are not discarded: verification is attempted
+against both the platform verifier and the merged pool, and succeeds if
+either builds a chain.`,
+			},
+			cli.StringFlag{
+				Name: "crl",
+				Usage: `Certificate Revocation List to check instead of the CRL
+distribution points embedded in the certificate. <crl> may be a local file
+path or an 'http://' or 'https://' URL.`,
+			},
+			cli.StringFlag{
+				Name: "ocsp",
+				Usage: `Controls how OCSP and CRL revocation checks are
+performed. <ocsp> is a case-sensitive string and must be one of:
+
+    **on**
+	:  Perform the checks and fail if a certificate is revoked or its
+	revocation status cannot be determined. This is the default.
+
+    **soft-fail**
+	:  Perform the checks, but only fail if a certificate is confirmed to be
+	revoked; print a warning if the revocation status could not be checked.
+
+    **off**
+	:  Do not perform revocation checks. Equivalent to --no-revocation-check.`,
+				Value: "on",
+			},
+			cli.BoolFlag{
+				Name:  "no-revocation-check",
+				Usage: `Do not check whether the certificate has been revoked. Equivalent to --ocsp=off.`,
+			},
+			cli.StringSliceFlag{
+				Name: "purpose",
+				Usage: `The key usage the certificate is expected to be used for. Repeat the
+flag to accept more than one purpose. <purpose> is a case-sensitive string
+and must be one of:
+
+    **any** (default)
+	:  Accept any key usage.
+
+    **server**
+	:  TLS server authentication.
+
+    **client**
+	:  TLS client authentication.
+
+    **code-signing**
+	:  Code signing.
+
+    **email**
+	:  Email protection.
+
+    **timestamping**
+	:  Time stamping.
+
+    **ocsp**
+	:  OCSP signing.`,
+			},
+			cli.StringFlag{
+				Name: "current-time",
+				Usage: `The time to use when checking certificate validity, formatted as RFC
+3339 (e.g. '2006-01-02T15:04:05-07:00'). Defaults to the current time; this
+flag is useful to reproducibly verify a certificate against a time in the
+past or future.`,
+			},
+			cli.StringFlag{
+				Name: "format",
+				Usage: `The output format for the verification result. <format> is a
+case-sensitive string and must be one of:
+
+    **text** (default)
+	:  Print nothing on success, and an error message on failure.
+
+    **json**
+	:  Print a structured result describing the leaf certificate, every
+	chain built during verification, the certificate lifetime, and any
+	revocation check results, suitable for consumption by scripts and CI
+	pipelines.`,
+				Value: "text",
+			},
+			cli.GenericFlag{
+				Name: "require-sct",
+				Usage: `Require the certificate to carry at least <value> valid Signed
+Certificate Timestamps (SCTs) from logs named by **--ct-logs**, per RFC 6962.
+Given without a value, <value> defaults to 2. A certificate with no known-log
+SCTs at all - the common case when **--ct-logs** is omitted - always fails
+this check.`,
+				Value: &requireSCTValue{},
+			},
+			cli.StringFlag{
+				Name: "ct-logs",
+				Usage: `A file of concatenated PEM encoded public keys, one per Certificate
+Transparency log operator, used to verify the SCTs **--require-sct** checks
+for. This repo does not ship a default log list, since the set of logs
+browsers currently trust changes often enough that a bundled one would go
+stale.`,
 			},
 			flags.ServerName,
 		},
@@ -116,11 +287,51 @@ func verifyAction(ctx *cli.Context) error {
 		verdancy         = ctx.Bool("verdancy")
 		serverName       = ctx.String("servername")
 		roots            = ctx.String("roots")
+		systemRoots      = ctx.String("system-roots")
+		rootsAppend      = ctx.String("roots-append")
+		crl              = ctx.String("crl")
+		ocspMode         = revocationMode(ctx.String("ocsp"))
+		ctLogsFile       = ctx.String("ct-logs")
 		intermediatePool = x509.NewCertPool()
+		intermediates    []*x509.Certificate
 		rootPool         *x509.CertPool
 		cert             *x509.Certificate
 	)
 
+	requireSCT, _ := ctx.Generic("require-sct").(*requireSCTValue)
+	ctLogs, err := loadCTLogs(ctLogsFile)
+	if err != nil {
+		return err
+	}
+
+	if ctx.Bool("no-revocation-check") {
+		ocspMode = revocationOff
+	}
+	switch ocspMode {
+	case revocationHardFail, revocationSoftFail, revocationOff:
+	default:
+		return errs.InvalidFlagValue(ctx, "ocsp", string(ocspMode), "on, soft-fail, off")
+	}
+
+	switch systemRoots {
+	case "merge", "replace", "off":
+	default:
+		return errs.InvalidFlagValue(ctx, "system-roots", systemRoots, "merge, replace, off")
+	}
+
+	keyUsages, err := purposesToKeyUsages(ctx.StringSlice("purpose"))
+	if err != nil {
+		return err
+	}
+
+	currentTime := time.Now()
+	if ct := ctx.String("current-time"); ct != "" {
+		currentTime, err = time.Parse(time.RFC3339, ct)
+		if err != nil {
+			return errs.InvalidFlagValue(ctx, "current-time", ct, "an RFC 3339 timestamp")
+		}
+	}
+
 	if addr, isURL, err := trimURL(crtFile); err != nil {
 		return err
 	} else if isURL {
@@ -132,16 +343,14 @@ func verifyAction(ctx *cli.Context) error {
 		for _, pc := range peerCertificates {
 			intermediatePool.AddCert(pc)
 		}
+		intermediates = peerCertificates[1:]
 	} else {
 		crtBytes, err := ioutil.ReadFile(crtFile)
 		if err != nil {
 			return errs.FileError(err, crtFile)
 		}
 
-		var (
-			ipems []byte
-			block *pem.Block
-		)
+		var block *pem.Block
 		// The first certificate PEM in the file is our leaf Certificate.
 		// Any certificate after the first is added to the list of Intermediate
 		// certificates used for path validation.
@@ -159,25 +368,59 @@ func verifyAction(ctx *cli.Context) error {
 					return errors.WithStack(err)
 				}
 			} else {
-				ipems = append(ipems, pem.EncodeToMemory(block)...)
+				ic, err := x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					return errors.Wrapf(err, "failure parsing intermediate certificate in '%s'", crtFile)
+				}
+				intermediatePool.AddCert(ic)
+				intermediates = append(intermediates, ic)
 			}
 		}
 		if cert == nil {
 			return errors.Errorf("%s contains no PEM certificate blocks", crtFile)
 		}
-		if len(ipems) > 0 && !intermediatePool.AppendCertsFromPEM(ipems) {
-			return errors.Errorf("failure creating intermediate list from certificate '%s'", crtFile)
-		}
 	}
 
 	if roots != "" {
 		var err error
-		rootPool, err = x509util.ReadCertPool(roots)
+		rootPool, err = x509util.ReadCertPoolForChain(roots, cert, intermediates...)
+		if err != nil {
+			return errors.Wrapf(err, "failure to load root certificate pool from input path '%s'", roots)
+		}
+	} else {
+		var err error
+		switch systemRoots {
+		case "replace":
+			rootPool, err = x509util.EnvCertPool()
+		case "merge":
+			rootPool, err = x509util.SystemCertPool()
+		case "off":
+			// Leave rootPool nil; x509.Certificate.Verify falls back to the
+			// operating system's default roots on its own.
+		}
 		if err != nil {
-			errors.Wrapf(err, "failure to load root certificate pool from input path '%s'", roots)
+			return errors.Wrap(err, "failure to load system root certificate pool")
 		}
 	}
 
+	format := ctx.String("format")
+	switch format {
+	case "text", "json":
+	default:
+		return errs.InvalidFlagValue(ctx, "format", format, "text, json")
+	}
+
+	if format == "json" {
+		opts := x509.VerifyOptions{
+			DNSName:       host,
+			Roots:         rootPool,
+			Intermediates: intermediatePool,
+			CurrentTime:   currentTime,
+			KeyUsages:     keyUsages,
+		}
+		return outputJSONVerification(cert, opts, rootsAppend, systemRoots, crl, ocspMode, currentTime, requireSCT, ctLogs)
+	}
+
 	if verdancy {
 
 		var remainingValidity = time.Until(cert.NotAfter).Hours()
@@ -225,16 +468,196 @@ func verifyAction(ctx *cli.Context) error {
 		DNSName:       host,
 		Roots:         rootPool,
 		Intermediates: intermediatePool,
-		// Support verification of any type of cert.
-		//
-		// TODO: add something like --purpose client,server,... and configure
-		// this property accordingly.
-		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		CurrentTime:   currentTime,
+		KeyUsages:     keyUsages,
 	}
 
-	if _, err := cert.Verify(opts); err != nil {
+	var chains [][]*x509.Certificate
+	if rootsAppend != "" {
+		chains, err = verifyWithAppendedRoots(cert, opts, rootsAppend, systemRoots)
+	} else {
+		chains, err = cert.Verify(opts)
+	}
+	if err != nil {
 		return errors.Wrapf(err, "failed to verify certificate")
 	}
 
+	if ocspMode != revocationOff {
+		for _, chain := range chains {
+			if err := checkRevocation(chain, crl, ocspMode); err != nil {
+				return errors.Wrapf(err, "failed to verify certificate")
+			}
+		}
+	}
+
+	if requireSCT != nil && requireSCT.set {
+		if len(chains[0]) < 2 {
+			return errors.Errorf("failed to verify certificate: a self-signed certificate cannot carry a Signed Certificate Timestamp")
+		}
+		if _, err := checkSCTs(chains[0][0], chains[0][1], ctLogs, requireSCT.count); err != nil {
+			return errors.Wrapf(err, "failed to verify certificate")
+		}
+	}
+
 	return nil
 }
+
+// outputJSONVerification runs path and revocation validation exactly like
+// the text mode does, but instead of returning the first error it collects
+// everything into a verifyResult and prints it as JSON, returning a non-nil
+// error only to set the process' exit code when valid is false.
+func outputJSONVerification(cert *x509.Certificate, opts x509.VerifyOptions, rootsAppend, systemRoots, crl string, ocspMode revocationMode, now time.Time, requireSCT *requireSCTValue, ctLogs map[[32]byte]interface{}) error {
+	result := verifyResult{
+		Valid:    true,
+		Leaf:     newCertSummary(cert),
+		Lifetime: lifetimeFor(cert, now),
+	}
+
+	var (
+		chains [][]*x509.Certificate
+		err    error
+	)
+	if rootsAppend != "" {
+		chains, err = verifyWithAppendedRoots(cert, opts, rootsAppend, systemRoots)
+	} else {
+		chains, err = cert.Verify(opts)
+	}
+	if err != nil {
+		result.Valid = false
+		result.Errors = append(result.Errors, err.Error())
+		return printAndFail(result)
+	}
+
+	for _, chain := range chains {
+		var summaries []certSummary
+		for _, c := range chain {
+			summaries = append(summaries, newCertSummary(c))
+		}
+		result.Chains = append(result.Chains, summaries)
+
+		if ocspMode == revocationOff {
+			continue
+		}
+		for _, rr := range checkRevocationDetailed(chain, crl, ocspMode) {
+			result.Revocation = append(result.Revocation, rr)
+			if rr.Status == "revoked" {
+				result.Valid = false
+				result.Errors = append(result.Errors, rr.Error)
+			} else if rr.Status == "unknown" && ocspMode == revocationHardFail {
+				result.Valid = false
+				result.Errors = append(result.Errors, rr.Error)
+			}
+		}
+	}
+
+	if requireSCT != nil && requireSCT.set {
+		var (
+			validCount int
+			sctErr     error
+		)
+		if len(chains[0]) < 2 {
+			sctErr = errors.New("a self-signed certificate cannot carry a Signed Certificate Timestamp")
+		} else {
+			validCount, sctErr = checkSCTs(chains[0][0], chains[0][1], ctLogs, requireSCT.count)
+		}
+		result.SCT = &sctSummary{Required: requireSCT.count, Valid: validCount}
+		if sctErr != nil {
+			result.Valid = false
+			result.Errors = append(result.Errors, sctErr.Error())
+		}
+	}
+
+	if !result.Valid {
+		return printAndFail(result)
+	}
+
+	return printVerifyResult(result)
+}
+
+// printAndFail prints result and returns an error so the command exits
+// non-zero, even though the JSON describing the failure has already been
+// written to stdout.
+func printAndFail(result verifyResult) error {
+	if err := printVerifyResult(result); err != nil {
+		return err
+	}
+	return errors.Errorf("certificate verification failed")
+}
+
+// verifyWithAppendedRoots verifies cert twice: once against the platform
+// verifier, by leaving opts.Roots nil, and once against the Go verifier
+// using opts.Roots (the pool built from --roots, if one was given) merged
+// with the custom roots described by rootsAppend. It succeeds if either
+// verification builds a chain, returning the union of the chains found.
+//
+// systemRoots is the resolved --system-roots mode, consulted only when
+// opts.Roots is nil (no --roots was given): "off" merges against the plain
+// OS trust store, matching the nil-Roots behavior used elsewhere in this
+// command, while every other value merges against x509util.SystemCertPool,
+// which also honors SSL_CERT_FILE/SSL_CERT_DIR.
+func verifyWithAppendedRoots(cert *x509.Certificate, opts x509.VerifyOptions, rootsAppend, systemRoots string) ([][]*x509.Certificate, error) {
+	systemOpts := opts
+	systemOpts.Roots = nil
+	systemChains, systemErr := cert.Verify(systemOpts)
+
+	var (
+		mergedPool *x509.CertPool
+		err        error
+	)
+	switch {
+	case opts.Roots != nil:
+		mergedPool = opts.Roots.Clone()
+	case systemRoots == "off":
+		mergedPool, err = x509.SystemCertPool()
+	default:
+		mergedPool, err = x509util.SystemCertPool()
+	}
+	if err != nil || mergedPool == nil {
+		mergedPool = x509.NewCertPool()
+	}
+	if err := x509util.AppendRootsFromPath(mergedPool, rootsAppend); err != nil {
+		return nil, errors.Wrapf(err, "failure to load root certificate pool from input path '%s'", rootsAppend)
+	}
+
+	mergedOpts := opts
+	mergedOpts.Roots = mergedPool
+	mergedChains, mergedErr := cert.Verify(mergedOpts)
+
+	if systemErr != nil && mergedErr != nil {
+		return nil, mergedErr
+	}
+
+	return append(systemChains, mergedChains...), nil
+}
+
+// purposeKeyUsages maps the case-sensitive values accepted by --purpose to
+// the x509.ExtKeyUsage they constrain verification to.
+var purposeKeyUsages = map[string]x509.ExtKeyUsage{
+	"any":          x509.ExtKeyUsageAny,
+	"server":       x509.ExtKeyUsageServerAuth,
+	"client":       x509.ExtKeyUsageClientAuth,
+	"code-signing": x509.ExtKeyUsageCodeSigning,
+	"email":        x509.ExtKeyUsageEmailProtection,
+	"timestamping": x509.ExtKeyUsageTimeStamping,
+	"ocsp":         x509.ExtKeyUsageOCSPSigning,
+}
+
+// purposesToKeyUsages converts the values of a repeatable --purpose flag
+// into the KeyUsages accepted by x509.VerifyOptions, defaulting to
+// x509.ExtKeyUsageAny when none were given.
+func purposesToKeyUsages(purposes []string) ([]x509.ExtKeyUsage, error) {
+	if len(purposes) == 0 {
+		return []x509.ExtKeyUsage{x509.ExtKeyUsageAny}, nil
+	}
+
+	keyUsages := make([]x509.ExtKeyUsage, len(purposes))
+	for i, p := range purposes {
+		ku, ok := purposeKeyUsages[p]
+		if !ok {
+			return nil, errors.Errorf("invalid value '%s' for flag '--purpose'; options are any, server, client, code-signing, email, timestamping, ocsp", p)
+		}
+		keyUsages[i] = ku
+	}
+
+	return keyUsages, nil
+}
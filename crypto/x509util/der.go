@@ -0,0 +1,110 @@
+package x509util
+
+import "github.com/pkg/errors"
+
+// derElement is one TLV (tag, length, value) read off the front of a DER
+// encoded byte string, along with whatever bytes follow it.
+type derElement struct {
+	tag     byte
+	header  []byte // the tag and length bytes, needed to re-assemble a raw element
+	content []byte
+	rest    []byte
+}
+
+// raw returns the element exactly as it appeared in the input: header
+// followed by content.
+func (e derElement) raw() []byte {
+	raw := make([]byte, 0, len(e.header)+len(e.content))
+	raw = append(raw, e.header...)
+	raw = append(raw, e.content...)
+	return raw
+}
+
+// readDERElement reads a single TLV off the front of b, without interpreting
+// its content. It understands only what's needed to skip over the fields of
+// a certificate's TBSCertificate: short and long form definite lengths.
+// Indefinite-length BER encodings, which DER certificates never use, are
+// rejected.
+func readDERElement(b []byte) (derElement, error) {
+	if len(b) < 2 {
+		return derElement{}, errors.New("x509util: truncated DER element")
+	}
+
+	tag := b[0]
+	length := int(b[1])
+	headerLen := 2
+
+	if length&0x80 != 0 {
+		numBytes := length & 0x7f
+		if numBytes == 0 || numBytes > 4 {
+			return derElement{}, errors.New("x509util: unsupported DER length encoding")
+		}
+		if len(b) < 2+numBytes {
+			return derElement{}, errors.New("x509util: truncated DER length")
+		}
+		length = 0
+		for i := 0; i < numBytes; i++ {
+			length = length<<8 | int(b[2+i])
+		}
+		headerLen = 2 + numBytes
+	}
+
+	if length < 0 || len(b) < headerLen+length {
+		return derElement{}, errors.New("x509util: truncated DER element")
+	}
+
+	return derElement{
+		tag:     tag,
+		header:  b[:headerLen],
+		content: b[headerLen : headerLen+length],
+		rest:    b[headerLen+length:],
+	}, nil
+}
+
+// asn1ContextTag0 is the tag byte of the TBSCertificate's optional, explicit
+// [0] version field - the only field before serialNumber, and one a v1
+// certificate omits.
+const asn1ContextTag0 = 0xa0
+
+// rawSubjectFromCertDER extracts the raw DER encoding of a certificate's
+// Subject field directly from its ASN.1 structure, without parsing the rest
+// of the certificate. This is the expensive part NewLazyCertPool avoids
+// doing for every certificate in a large trust store: Subject is the sixth
+// field of TBSCertificate, so reaching it only requires skipping over the
+// (optional) version, serialNumber, signature algorithm, issuer, and
+// validity fields.
+func rawSubjectFromCertDER(der []byte) ([]byte, error) {
+	certSeq, err := readDERElement(der)
+	if err != nil {
+		return nil, err
+	}
+	tbsSeq, err := readDERElement(certSeq.content)
+	if err != nil {
+		return nil, err
+	}
+
+	rest := tbsSeq.content
+	if len(rest) > 0 && rest[0] == asn1ContextTag0 {
+		version, err := readDERElement(rest)
+		if err != nil {
+			return nil, err
+		}
+		rest = version.rest
+	}
+
+	// serialNumber, signature, issuer, validity - skip each in turn.
+	for i := 0; i < 4; i++ {
+		el, err := readDERElement(rest)
+		if err != nil {
+			return nil, errors.Wrap(err, "x509util: malformed TBSCertificate")
+		}
+		rest = el.rest
+	}
+
+	subject, err := readDERElement(rest)
+	if err != nil {
+		return nil, errors.Wrap(err, "x509util: malformed TBSCertificate subject")
+	}
+
+	return subject.raw(), nil
+}
@@ -0,0 +1,71 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"os"
+	"strings"
+)
+
+// appendEnvRoots adds to pool the certificate(s) in the first of
+// STEP_SSL_CERT_FILE or SSL_CERT_FILE that is set, and those in every
+// directory listed in SSL_CERT_DIR (colon-separated, as with OpenSSL's
+// CAdir) when that is set too.
+func appendEnvRoots(pool *x509.CertPool) error {
+	if file := firstNonEmptyEnv("STEP_SSL_CERT_FILE", "SSL_CERT_FILE"); file != "" {
+		if err := AppendRootsFromPath(pool, file); err != nil {
+			return err
+		}
+	}
+
+	if dir := os.Getenv("SSL_CERT_DIR"); dir != "" {
+		for _, d := range strings.Split(dir, ":") {
+			if d == "" {
+				continue
+			}
+			if err := AppendRootsFromPath(pool, d); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func firstNonEmptyEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// EnvCertPool builds a certificate pool solely from STEP_SSL_CERT_FILE,
+// SSL_CERT_FILE, or SSL_CERT_DIR; it returns an empty pool if none of them
+// are set, without ever consulting the operating system's trust store.
+func EnvCertPool() (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if err := appendEnvRoots(pool); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// SystemCertPool returns the operating system's trusted root certificates
+// merged with any additional roots named by STEP_SSL_CERT_FILE,
+// SSL_CERT_FILE, or SSL_CERT_DIR - the convention used by OpenSSL and
+// NixOS. This lets step be pointed at an alternate trust bundle, a common
+// need in containerized or hermetic build environments, without touching
+// OS state.
+func SystemCertPool() (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	if err := appendEnvRoots(pool); err != nil {
+		return nil, err
+	}
+
+	return pool, nil
+}
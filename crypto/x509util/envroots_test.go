@@ -0,0 +1,160 @@
+package x509util
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedRoot writes a freshly generated self-signed root
+// certificate to dir/name and returns its parsed form.
+func writeSelfSignedRoot(t *testing.T, dir, name string) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Unix(0, 0),
+		NotAfter:              time.Unix(0, 0).Add(100 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestEnvCertPool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "x509util-envroots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("empty when nothing is set", func(t *testing.T) {
+		unsetEnv(t, "STEP_SSL_CERT_FILE", "SSL_CERT_FILE", "SSL_CERT_DIR")
+		pool, err := EnvCertPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if subjects := pool.Subjects(); len(subjects) != 0 {
+			t.Errorf("expected an empty pool, got %d subjects", len(subjects))
+		}
+	})
+
+	t.Run("SSL_CERT_FILE is loaded", func(t *testing.T) {
+		unsetEnv(t, "STEP_SSL_CERT_FILE", "SSL_CERT_FILE", "SSL_CERT_DIR")
+		cert := writeSelfSignedRoot(t, dir, "file-root.pem")
+		t.Setenv("SSL_CERT_FILE", filepath.Join(dir, "file-root.pem"))
+
+		pool, err := EnvCertPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cert.Verify(x509.VerifyOptions{Roots: pool}); err != nil {
+			t.Errorf("expected cert to verify against SSL_CERT_FILE's pool: %v", err)
+		}
+	})
+
+	t.Run("STEP_SSL_CERT_FILE takes priority over SSL_CERT_FILE", func(t *testing.T) {
+		unsetEnv(t, "STEP_SSL_CERT_FILE", "SSL_CERT_FILE", "SSL_CERT_DIR")
+		stepCert := writeSelfSignedRoot(t, dir, "step-root.pem")
+		writeSelfSignedRoot(t, dir, "generic-root.pem")
+		t.Setenv("STEP_SSL_CERT_FILE", filepath.Join(dir, "step-root.pem"))
+		t.Setenv("SSL_CERT_FILE", filepath.Join(dir, "generic-root.pem"))
+
+		pool, err := EnvCertPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stepCert.Verify(x509.VerifyOptions{Roots: pool}); err != nil {
+			t.Errorf("expected STEP_SSL_CERT_FILE's cert to verify: %v", err)
+		}
+		if len(pool.Subjects()) != 1 {
+			t.Errorf("expected only STEP_SSL_CERT_FILE to be loaded, got %d roots", len(pool.Subjects()))
+		}
+	})
+
+	t.Run("SSL_CERT_DIR is a colon-separated list of directories", func(t *testing.T) {
+		unsetEnv(t, "STEP_SSL_CERT_FILE", "SSL_CERT_FILE", "SSL_CERT_DIR")
+		dirA, err := ioutil.TempDir("", "x509util-envroots-a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dirA)
+		dirB, err := ioutil.TempDir("", "x509util-envroots-b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dirB)
+
+		certA := writeSelfSignedRoot(t, dirA, "a-root.pem")
+		certB := writeSelfSignedRoot(t, dirB, "b-root.pem")
+		t.Setenv("SSL_CERT_DIR", dirA+":"+dirB)
+
+		pool, err := EnvCertPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := certA.Verify(x509.VerifyOptions{Roots: pool}); err != nil {
+			t.Errorf("expected dirA's cert to verify: %v", err)
+		}
+		if _, err := certB.Verify(x509.VerifyOptions{Roots: pool}); err != nil {
+			t.Errorf("expected dirB's cert to verify: %v", err)
+		}
+	})
+}
+
+func TestSystemCertPool_AppendsEnvRoots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "x509util-envroots-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	unsetEnv(t, "STEP_SSL_CERT_FILE", "SSL_CERT_FILE", "SSL_CERT_DIR")
+	cert := writeSelfSignedRoot(t, dir, "file-root.pem")
+	t.Setenv("SSL_CERT_FILE", filepath.Join(dir, "file-root.pem"))
+
+	pool, err := SystemCertPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: pool}); err != nil {
+		t.Errorf("expected SystemCertPool to also trust SSL_CERT_FILE's cert: %v", err)
+	}
+}
+
+// unsetEnv clears the named environment variables for the duration of the
+// test, restoring their previous values afterward. appendEnvRoots treats an
+// empty value the same as an unset one, so t.Setenv alone is enough.
+func unsetEnv(t *testing.T, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		t.Setenv(name, "")
+	}
+}
@@ -0,0 +1,220 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// lazyCertEntry locates one PEM encoded certificate block inside a file,
+// without having parsed it.
+type lazyCertEntry struct {
+	file       string
+	blockIndex int
+}
+
+// LazyCertPool indexes a directory of PEM encoded certificates by subject
+// without parsing any of them, and calls x509.ParseCertificate only for the
+// entries a caller actually looks up. This mirrors the approach upstream Go
+// uses for the platform's system root pool, where certificates are resolved
+// lazily while a chain is built rather than all being parsed up front - path
+// building for a single leaf usually only ever consults a handful of
+// subjects out of a trust store that may contain hundreds of CAs.
+type LazyCertPool struct {
+	bySubject map[string][]*lazyCertEntry
+	cache     map[string]*x509.Certificate
+}
+
+// NewLazyCertPool indexes every PEM encoded certificate found in dir.
+// Indexing reads only as far into each certificate's TBSCertificate as
+// needed to reach the Subject field - it never calls x509.ParseCertificate.
+func NewLazyCertPool(dir string) (*LazyCertPool, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failure reading directory '%s'", dir)
+	}
+
+	pool := &LazyCertPool{
+		bySubject: make(map[string][]*lazyCertEntry),
+		cache:     make(map[string]*x509.Certificate),
+	}
+
+	for _, fi := range entries {
+		if fi.IsDir() {
+			continue
+		}
+		if err := pool.indexFile(filepath.Join(dir, fi.Name())); err != nil {
+			return nil, err
+		}
+	}
+
+	return pool, nil
+}
+
+func (p *LazyCertPool) indexFile(file string) error {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return errors.Wrapf(err, "failure reading '%s'", file)
+	}
+
+	certIndex := 0
+	for {
+		var block *pem.Block
+		block, raw = pem.Decode(raw)
+		if block == nil {
+			return nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		idx := certIndex
+		certIndex++
+
+		subject, err := rawSubjectFromCertDER(block.Bytes)
+		if err != nil {
+			// This lightweight scan couldn't make sense of the entry; skip
+			// indexing it. A full parse, were it ever reached some other
+			// way, would surface the real error.
+			continue
+		}
+
+		key := string(subject)
+		p.bySubject[key] = append(p.bySubject[key], &lazyCertEntry{file: file, blockIndex: idx})
+	}
+}
+
+// parse fully parses the certificate located by e, caching the result so a
+// given entry is never read off disk more than once.
+func (p *LazyCertPool) parse(e *lazyCertEntry) (*x509.Certificate, error) {
+	cacheKey := fmt.Sprintf("%s#%d", e.file, e.blockIndex)
+	if cert, ok := p.cache[cacheKey]; ok {
+		return cert, nil
+	}
+
+	raw, err := ioutil.ReadFile(e.file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failure reading '%s'", e.file)
+	}
+
+	certIndex := 0
+	for {
+		var block *pem.Block
+		block, raw = pem.Decode(raw)
+		if block == nil {
+			return nil, errors.Errorf("could not find certificate #%d in '%s'", e.blockIndex, e.file)
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if certIndex != e.blockIndex {
+			certIndex++
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failure parsing certificate in '%s'", e.file)
+		}
+		p.cache[cacheKey] = cert
+		return cert, nil
+	}
+}
+
+// Lookup parses and returns every certificate indexed under subject.
+func (p *LazyCertPool) Lookup(subject []byte) ([]*x509.Certificate, error) {
+	entries := p.bySubject[string(subject)]
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	certs := make([]*x509.Certificate, 0, len(entries))
+	for _, e := range entries {
+		cert, err := p.parse(e)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// ResolveChain builds the smallest *x509.CertPool that can complete a chain
+// for leaf: starting from leaf's issuer, it looks up and parses only the
+// certificates needed to walk up to a self-signed root, rather than parsing
+// every certificate this pool indexed.
+//
+// intermediates are certificates the caller already parsed out of leaf's own
+// certificate file (e.g. a fullchain.pem bundling leaf and intermediate) and
+// are not necessarily present in this pool's directory. They are consulted
+// to continue the walk through any hop this pool doesn't cover, but are
+// never themselves added to the returned pool - callers hand them to
+// x509.VerifyOptions.Intermediates separately.
+func (p *LazyCertPool) ResolveChain(leaf *x509.Certificate, intermediates ...*x509.Certificate) (*x509.CertPool, error) {
+	knownIntermediates := make(map[string][]*x509.Certificate, len(intermediates))
+	for _, c := range intermediates {
+		key := string(c.RawSubject)
+		knownIntermediates[key] = append(knownIntermediates[key], c)
+	}
+
+	pool := x509.NewCertPool()
+	seen := make(map[string]bool)
+	queue := [][]byte{leaf.RawIssuer}
+
+	for len(queue) > 0 {
+		subject := queue[0]
+		queue = queue[1:]
+
+		key := string(subject)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		certs, err := p.Lookup(subject)
+		if err != nil {
+			return nil, err
+		}
+		for _, cert := range certs {
+			pool.AddCert(cert)
+			if !bytes.Equal(cert.RawSubject, cert.RawIssuer) {
+				queue = append(queue, cert.RawIssuer)
+			}
+		}
+
+		if len(certs) == 0 {
+			// This hop isn't in the roots directory; see if it's one of the
+			// intermediates the caller already parsed out of the
+			// certificate file, and keep walking from its issuer.
+			for _, cert := range knownIntermediates[key] {
+				if !bytes.Equal(cert.RawSubject, cert.RawIssuer) {
+					queue = append(queue, cert.RawIssuer)
+				}
+			}
+		}
+	}
+
+	return pool, nil
+}
+
+// CertPool fully parses every certificate this pool indexed and returns
+// them as a standard *x509.CertPool. Prefer ResolveChain, which parses only
+// the certificates actually needed to verify a specific leaf.
+func (p *LazyCertPool) CertPool() (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, entries := range p.bySubject {
+		for _, e := range entries {
+			cert, err := p.parse(e)
+			if err != nil {
+				return nil, err
+			}
+			pool.AddCert(cert)
+		}
+	}
+	return pool, nil
+}
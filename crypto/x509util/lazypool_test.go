@@ -0,0 +1,261 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setupPoolDir writes n self-signed root certificates to a new temporary
+// directory and returns a leaf certificate signed by the first of them, so
+// that resolving its chain only ever needs that one root.
+func setupPoolDir(n int) (dir string, leaf *x509.Certificate, err error) {
+	dir, err = ioutil.TempDir("", "x509util-pool")
+	if err != nil {
+		return "", nil, err
+	}
+
+	var signer *ecdsa.PrivateKey
+	var signerCert *x509.Certificate
+
+	for i := 0; i < n; i++ {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return "", nil, err
+		}
+
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(int64(i) + 1),
+			Subject:               pkix.Name{CommonName: fmt.Sprintf("root-%d", i)},
+			NotBefore:             time.Unix(0, 0),
+			NotAfter:              time.Unix(0, 0).Add(100 * 365 * 24 * time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("root-%d.pem", i)), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+			return "", nil, err
+		}
+
+		if i == 0 {
+			signer = key
+			signerCert, err = x509.ParseCertificate(der)
+			if err != nil {
+				return "", nil, err
+			}
+		}
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", nil, err
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(int64(n) + 1),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Unix(0, 0).Add(100 * 365 * 24 * time.Hour),
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, signerCert, &leafKey.PublicKey, signer)
+	if err != nil {
+		return "", nil, err
+	}
+	leaf, err = x509.ParseCertificate(leafDER)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return dir, leaf, nil
+}
+
+func TestLazyCertPool_ResolveChain(t *testing.T) {
+	dir, leaf, err := setupPoolDir(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lazyPool, err := NewLazyCertPool(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := lazyPool.ResolveChain(leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: pool}); err != nil {
+		t.Errorf("expected leaf to verify against the resolved pool: %v", err)
+	}
+}
+
+// setupPoolDirWithIntermediate writes a single self-signed root to a new
+// temporary directory, and returns a leaf signed by an intermediate that is
+// itself signed by that root - mirroring a fullchain.pem that bundles a leaf
+// with its intermediate, verified against a --roots directory holding only
+// root CAs. The intermediate is deliberately not written to dir.
+func setupPoolDirWithIntermediate() (dir string, leaf, intermediate *x509.Certificate, err error) {
+	dir, err = ioutil.TempDir("", "x509util-pool-intermediate")
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "root"},
+		NotBefore:             time.Unix(0, 0),
+		NotAfter:              time.Unix(0, 0).Add(100 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	rootCert, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "root.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootDER}), 0600); err != nil {
+		return "", nil, nil, err
+	}
+
+	intermediateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	intermediateTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "intermediate"},
+		NotBefore:             time.Unix(0, 0),
+		NotAfter:              time.Unix(0, 0).Add(100 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	intermediateDER, err := x509.CreateCertificate(rand.Reader, intermediateTemplate, rootCert, &intermediateKey.PublicKey, rootKey)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	intermediate, err = x509.ParseCertificate(intermediateDER)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Unix(0, 0).Add(100 * 365 * 24 * time.Hour),
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, intermediate, &leafKey.PublicKey, intermediateKey)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	leaf, err = x509.ParseCertificate(leafDER)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	return dir, leaf, intermediate, nil
+}
+
+func TestLazyCertPool_ResolveChain_BundledIntermediate(t *testing.T) {
+	dir, leaf, intermediate, err := setupPoolDirWithIntermediate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lazyPool, err := NewLazyCertPool(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("without the intermediate, the walk dead-ends at the root directory", func(t *testing.T) {
+		pool, err := lazyPool.ResolveChain(leaf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := leaf.Verify(x509.VerifyOptions{Roots: pool}); err == nil {
+			t.Fatal("expected verification to fail without the intermediate")
+		}
+	})
+
+	t.Run("passing the intermediate completes the walk to the root", func(t *testing.T) {
+		pool, err := lazyPool.ResolveChain(leaf, intermediate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		intermediatePool := x509.NewCertPool()
+		intermediatePool.AddCert(intermediate)
+
+		if _, err := leaf.Verify(x509.VerifyOptions{Roots: pool, Intermediates: intermediatePool}); err != nil {
+			t.Errorf("expected leaf to verify against the resolved pool: %v", err)
+		}
+		// The intermediate itself is not a root and must not be in the pool.
+		for _, name := range pool.Subjects() {
+			if bytes.Equal(name, intermediate.RawSubject) {
+				t.Error("expected the intermediate not to be added to the resolved root pool")
+			}
+		}
+	})
+}
+
+// BenchmarkReadCertPool compares parsing every certificate in a directory of
+// CAs (ReadCertPool) against resolving just the one chain a leaf actually
+// needs (NewLazyCertPool + ResolveChain).
+func BenchmarkReadCertPool(b *testing.B) {
+	dir, leaf, err := setupPoolDir(500)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b.Run("Eager", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := ReadCertPool(dir); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Lazy", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			lazyPool, err := NewLazyCertPool(dir)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := lazyPool.ResolveChain(leaf); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
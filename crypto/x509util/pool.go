@@ -0,0 +1,107 @@
+// Package x509util provides utilities for working with x509 certificates and
+// certificate pools that are not covered by the standard library.
+package x509util
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ReadCertPool loads a certificate pool from disk. <roots> may be:
+//
+//   - the path to a single file containing one or more PEM encoded
+//     certificates,
+//   - a comma-separated list of such files, or
+//   - the path to a directory, in which case every file in it is read.
+//
+// Every certificate found is fully parsed. When <roots> is a directory that
+// may hold hundreds of CAs and only one chain needs to be verified, prefer
+// ReadCertPoolForChain, which parses only the certificates a specific leaf
+// actually needs.
+func ReadCertPool(roots string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if err := AppendRootsFromPath(pool, roots); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// ReadCertPoolForChain is like ReadCertPool, but when <roots> is a
+// directory it avoids parsing every certificate in it: the directory is
+// indexed by subject via NewLazyCertPool, and only the certificates on
+// leaf's path to a root are ever parsed. Files and comma-separated lists of
+// files, which are typically small, are still read eagerly via ReadCertPool.
+//
+// intermediates are certificates the caller already parsed out of leaf's own
+// certificate file (e.g. a fullchain.pem bundling leaf and intermediate).
+// They are consulted to continue the walk through any hop the roots
+// directory doesn't itself contain, without being added to the returned
+// pool - callers are expected to pass them to x509.VerifyOptions.Intermediates
+// separately.
+func ReadCertPoolForChain(roots string, leaf *x509.Certificate, intermediates ...*x509.Certificate) (*x509.CertPool, error) {
+	fi, err := os.Stat(roots)
+	if err != nil || !fi.IsDir() {
+		return ReadCertPool(roots)
+	}
+
+	lazyPool, err := NewLazyCertPool(roots)
+	if err != nil {
+		return nil, err
+	}
+	return lazyPool.ResolveChain(leaf, intermediates...)
+}
+
+// AppendRootsFromPath loads the certificate(s) described by roots - using the
+// same <roots> syntax as ReadCertPool - and adds them to pool. It is used to
+// build the pool returned by ReadCertPool, and to extend an existing pool,
+// such as the operating system's, with additional roots.
+func AppendRootsFromPath(pool *x509.CertPool, roots string) error {
+	fi, err := os.Stat(roots)
+	switch {
+	case err == nil && fi.IsDir():
+		return appendRootsFromDir(pool, roots)
+	case err == nil:
+		return appendRootsFromFiles(pool, []string{roots})
+	default:
+		// Not a single path on disk; treat it as a comma-separated list.
+		return appendRootsFromFiles(pool, strings.Split(roots, ","))
+	}
+}
+
+func appendRootsFromDir(pool *x509.CertPool, dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.Wrapf(err, "failure reading directory '%s'", dir)
+	}
+
+	files := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+
+	return appendRootsFromFiles(pool, files)
+}
+
+func appendRootsFromFiles(pool *x509.CertPool, files []string) error {
+	for _, f := range files {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		raw, err := ioutil.ReadFile(f)
+		if err != nil {
+			return errors.Wrapf(err, "failure reading '%s'", f)
+		}
+		if !pool.AppendCertsFromPEM(raw) {
+			return errors.Errorf("failure loading certificates from '%s'", f)
+		}
+	}
+	return nil
+}